@@ -0,0 +1,289 @@
+// Package client4 implements a DHCPv4 client state machine (DORA: Discover,
+// Offer, Request, Ack) over a raw link-layer socket, so it can run before
+// the host has any IP address, on Linux (AF_PACKET) and BSD/macOS (BPF)
+// alike, via mdlayher/raw. Wire framing is shared with server4 through
+// dhcpv4/internal/rawconn, so both sides of the protocol stay in sync.
+package client4
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/mdlayher/raw"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv4/internal/rawconn"
+)
+
+const (
+	clientPort = 68
+	serverPort = 67
+
+	etherTypeIPv4 = 0x0800
+
+	// recvBacklog bounds how many unconsumed, matching-or-not responses we
+	// buffer, so a late stray OFFER does not block the reader goroutine.
+	// When the backlog is full, readLoop drops the oldest buffered message
+	// to make room for the newest.
+	recvBacklog = 5
+
+	initialRetransmit = time.Second
+	maxRetransmit     = 64 * time.Second
+)
+
+// Lease is the result of a successful DORA exchange or Renew.
+type Lease struct {
+	Offer *dhcpv4.DHCPv4 // nil when obtained via Renew
+	ACK   *dhcpv4.DHCPv4
+}
+
+// IPAddr returns the leased address, i.e. l.ACK.YourIPAddr.
+func (l *Lease) IPAddr() net.IP {
+	return l.ACK.YourIPAddr
+}
+
+// Client implements the DORA state machine over a raw socket on a single
+// interface.
+type Client struct {
+	ifi  *net.Interface
+	conn *raw.Conn
+
+	recvCh  chan *dhcpv4.DHCPv4
+	readErr chan error
+	done    chan struct{}
+
+	maxRetransmits int
+}
+
+// ClientOpt configures optional Client behavior.
+type ClientOpt func(*Client)
+
+// WithMaxRetransmits caps the number of transmissions per exchange (the
+// first send included) before giving up. The default is 4.
+func WithMaxRetransmits(n int) ClientOpt {
+	return func(c *Client) { c.maxRetransmits = n }
+}
+
+// NewClient opens a raw socket on ifi and starts the client's background
+// reader. Callers must call Close when done.
+func NewClient(ifi *net.Interface, opts ...ClientOpt) (*Client, error) {
+	conn, err := raw.ListenPacket(ifi, etherTypeIPv4, nil)
+	if err != nil {
+		return nil, fmt.Errorf("client4: opening raw socket on %s: %w", ifi.Name, err)
+	}
+	c := &Client{
+		ifi:            ifi,
+		conn:           conn,
+		recvCh:         make(chan *dhcpv4.DHCPv4, recvBacklog),
+		readErr:        make(chan error, 1),
+		done:           make(chan struct{}),
+		maxRetransmits: 4,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// Close stops the background reader and closes the raw socket.
+func (c *Client) Close() error {
+	close(c.done)
+	return c.conn.Close()
+}
+
+// readLoop continuously parses incoming frames addressed to the DHCPv4
+// client port and forwards them to recvCh. Frames for other ports (or that
+// fail to parse) are silently dropped, same as any other noise on the wire.
+func (c *Client) readLoop() {
+	frame := make([]byte, 65536)
+	for {
+		n, _, err := c.conn.ReadFrom(frame)
+		if err != nil {
+			select {
+			case <-c.done:
+			case c.readErr <- err:
+			}
+			return
+		}
+		_, _, _, _, _, dstPort, payload, err := rawconn.ParseUDP4Frame(frame[:n])
+		if err != nil || dstPort != clientPort {
+			continue
+		}
+		m, err := dhcpv4.FromBytes(payload)
+		if err != nil {
+			continue
+		}
+		select {
+		case c.recvCh <- m:
+		case <-c.done:
+			return
+		default:
+			// Backlog full: drop the oldest pending message rather than
+			// block the reader, since a wedged reader would stall every
+			// future exchange, not just this one.
+			select {
+			case <-c.recvCh:
+			default:
+			}
+			select {
+			case c.recvCh <- m:
+			default:
+			}
+		}
+	}
+}
+
+// DiscoverOffer broadcasts a DHCPDISCOVER and returns the first matching
+// DHCPOFFER received, retransmitting with exponential backoff per RFC 2131
+// §4.1 until ctx is done or the retransmit limit is reached.
+func (c *Client) DiscoverOffer(ctx context.Context) (*dhcpv4.DHCPv4, error) {
+	xid, err := dhcpv4.GenerateTransactionID()
+	if err != nil {
+		return nil, err
+	}
+	return c.exchange(ctx, xid, func() (*dhcpv4.DHCPv4, error) {
+		return dhcpv4.NewDiscovery(c.ifi.HardwareAddr, dhcpv4.WithTransactionID(xid))
+	}, dhcpv4.MessageTypeOffer)
+}
+
+// Request sends a DHCPREQUEST selecting offer and returns the resulting
+// DHCPACK. A stray DHCPOFFER from another server arriving while we wait --
+// the duplicate-OFFER case fixed in the Fuchsia netstack DHCP client -- is
+// discarded rather than treated as a failed handshake. A DHCPNAK is
+// returned as an error.
+func (c *Client) Request(ctx context.Context, offer *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, error) {
+	xid := offer.TransactionID
+	reply, err := c.exchange(ctx, xid, func() (*dhcpv4.DHCPv4, error) {
+		return dhcpv4.NewRequestFromOffer(offer)
+	}, dhcpv4.MessageTypeAck, dhcpv4.MessageTypeNak)
+	if err != nil {
+		return nil, err
+	}
+	if reply.MessageType() == dhcpv4.MessageTypeNak {
+		return nil, fmt.Errorf("client4: server %s sent NAK", reply.ServerIdentifier())
+	}
+	return reply, nil
+}
+
+// DORA runs a full Discover/Offer/Request/Ack exchange and returns the
+// resulting Lease.
+func (c *Client) DORA(ctx context.Context) (*Lease, error) {
+	offer, err := c.DiscoverOffer(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("client4: DISCOVER: %w", err)
+	}
+	ack, err := c.Request(ctx, offer)
+	if err != nil {
+		return nil, fmt.Errorf("client4: REQUEST: %w", err)
+	}
+	return &Lease{Offer: offer, ACK: ack}, nil
+}
+
+// Renew sends a DHCPREQUEST renewing lease, with ciaddr set to the leased
+// address, and returns the refreshed Lease. Like every message this Client
+// sends, the request is broadcast at the link layer to 255.255.255.255; it
+// is not unicast to the server that granted the lease.
+func (c *Client) Renew(ctx context.Context, lease *Lease) (*Lease, error) {
+	xid, err := dhcpv4.GenerateTransactionID()
+	if err != nil {
+		return nil, err
+	}
+	ack, err := c.exchange(ctx, xid, func() (*dhcpv4.DHCPv4, error) {
+		return dhcpv4.New(
+			dhcpv4.WithTransactionID(xid),
+			dhcpv4.WithHwAddr(c.ifi.HardwareAddr),
+			dhcpv4.WithMessageType(dhcpv4.MessageTypeRequest),
+			dhcpv4.WithClientIP(lease.ACK.YourIPAddr),
+			dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(lease.ACK.YourIPAddr)),
+		)
+	}, dhcpv4.MessageTypeAck, dhcpv4.MessageTypeNak)
+	if err != nil {
+		return nil, fmt.Errorf("client4: renewing %s: %w", lease.IPAddr(), err)
+	}
+	if ack.MessageType() == dhcpv4.MessageTypeNak {
+		return nil, fmt.Errorf("client4: server %s NAKed renewal of %s", ack.ServerIdentifier(), lease.IPAddr())
+	}
+	return &Lease{ACK: ack}, nil
+}
+
+// exchange broadcasts the message built by build, retransmitting with
+// exponential backoff until a response with a matching TransactionID and
+// one of the wanted message types arrives, ctx is done, or the retransmit
+// limit is reached. Responses with a matching XID but an unwanted type are
+// discarded and waiting continues, rather than aborting the handshake.
+func (c *Client) exchange(ctx context.Context, xid dhcpv4.TransactionID, build func() (*dhcpv4.DHCPv4, error), want ...dhcpv4.MessageType) (*dhcpv4.DHCPv4, error) {
+	backoff := initialRetransmit
+	for attempt := 0; ; attempt++ {
+		msg, err := build()
+		if err != nil {
+			return nil, err
+		}
+		if err := c.send(msg); err != nil {
+			return nil, err
+		}
+
+		timer := time.NewTimer(backoff)
+		response, timedOut, err := c.waitForResponse(ctx, timer, xid, want)
+		timer.Stop()
+		if err != nil {
+			return nil, err
+		}
+		if !timedOut {
+			return response, nil
+		}
+
+		if attempt+1 >= c.maxRetransmits {
+			return nil, fmt.Errorf("client4: no response after %d attempts", attempt+1)
+		}
+		backoff *= 2
+		if backoff > maxRetransmit {
+			backoff = maxRetransmit
+		}
+	}
+}
+
+func (c *Client) waitForResponse(ctx context.Context, timer *time.Timer, xid dhcpv4.TransactionID, want []dhcpv4.MessageType) (*dhcpv4.DHCPv4, bool, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		case err := <-c.readErr:
+			return nil, false, err
+		case m := <-c.recvCh:
+			if m.TransactionID != xid {
+				continue
+			}
+			if messageTypeIn(m.MessageType(), want) {
+				return m, false, nil
+			}
+			// Matching XID, unwanted type: e.g. a second server's stray
+			// OFFER while we wait for an ACK/NAK. Keep waiting.
+			continue
+		case <-timer.C:
+			return nil, true, nil
+		}
+	}
+}
+
+func messageTypeIn(mt dhcpv4.MessageType, want []dhcpv4.MessageType) bool {
+	for _, w := range want {
+		if mt == w {
+			return true
+		}
+	}
+	return false
+}
+
+// send broadcasts m at the link layer from 0.0.0.0:68 to 255.255.255.255:67,
+// the way a client with no IP configured yet must.
+func (c *Client) send(m *dhcpv4.DHCPv4) error {
+	frame, err := rawconn.BuildUDP4Frame(c.ifi.HardwareAddr, rawconn.EtherBroadcast, net.IPv4zero, net.IPv4bcast, clientPort, serverPort, m.ToBytes())
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.WriteTo(frame, &raw.Addr{HardwareAddr: rawconn.EtherBroadcast})
+	return err
+}
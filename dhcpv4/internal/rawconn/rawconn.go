@@ -0,0 +1,152 @@
+// Package rawconn implements the minimal Ethernet/IPv4/UDP framing needed to
+// send and receive DHCPv4 traffic over an AF_PACKET/BPF raw socket, i.e.
+// without a bound, configured IP address. It is shared by server4 and
+// client4 so that both sides of the protocol agree on how frames are built
+// and parsed.
+package rawconn
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+)
+
+// EtherBroadcast is the Ethernet broadcast address, ff:ff:ff:ff:ff:ff.
+var EtherBroadcast = net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+const (
+	etherTypeIPv4  = 0x0800
+	ipProtoUDP     = 17
+	ipv4HeaderLen  = 20
+	udpHeaderLen   = 8
+	ethHeaderLen   = 14
+	minFrameLength = ethHeaderLen + ipv4HeaderLen + udpHeaderLen
+)
+
+// ErrShortFrame is returned by ParseUDP4Frame when the frame is too short to
+// contain an Ethernet, IPv4 and UDP header.
+var ErrShortFrame = errors.New("rawconn: frame too short to be a UDP/IPv4 packet")
+
+// ErrNotUDP4 is returned by ParseUDP4Frame when the frame is not an
+// Ethernet+IPv4+UDP frame.
+var ErrNotUDP4 = errors.New("rawconn: not an IPv4/UDP frame")
+
+// BuildUDP4Frame serializes an Ethernet frame carrying an IPv4/UDP datagram
+// with the given addressing and payload. It fills in the IPv4 and UDP
+// checksums.
+func BuildUDP4Frame(srcMAC, dstMAC net.HardwareAddr, srcIP, dstIP net.IP, srcPort, dstPort int, payload []byte) ([]byte, error) {
+	srcIP4, dstIP4 := srcIP.To4(), dstIP.To4()
+	if srcIP4 == nil || dstIP4 == nil {
+		return nil, errors.New("rawconn: src and dst must be IPv4 addresses")
+	}
+	if len(srcMAC) != 6 || len(dstMAC) != 6 {
+		return nil, errors.New("rawconn: src and dst MAC must be 6 bytes")
+	}
+
+	udpLen := udpHeaderLen + len(payload)
+	totalLen := ipv4HeaderLen + udpLen
+	frame := make([]byte, ethHeaderLen+totalLen)
+
+	// Ethernet header.
+	copy(frame[0:6], dstMAC)
+	copy(frame[6:12], srcMAC)
+	binary.BigEndian.PutUint16(frame[12:14], etherTypeIPv4)
+
+	// IPv4 header.
+	ip := frame[ethHeaderLen : ethHeaderLen+ipv4HeaderLen]
+	ip[0] = 0x45 // version 4, IHL 5 (no options)
+	ip[1] = 0x00 // DSCP/ECN
+	binary.BigEndian.PutUint16(ip[2:4], uint16(totalLen))
+	binary.BigEndian.PutUint16(ip[4:6], 0) // identification
+	binary.BigEndian.PutUint16(ip[6:8], 0) // flags/fragment offset
+	ip[8] = 64                             // TTL
+	ip[9] = ipProtoUDP
+	binary.BigEndian.PutUint16(ip[10:12], 0) // checksum, filled below
+	copy(ip[12:16], srcIP4)
+	copy(ip[16:20], dstIP4)
+	binary.BigEndian.PutUint16(ip[10:12], checksum(ip))
+
+	// UDP header + payload.
+	udp := frame[ethHeaderLen+ipv4HeaderLen:]
+	binary.BigEndian.PutUint16(udp[0:2], uint16(srcPort))
+	binary.BigEndian.PutUint16(udp[2:4], uint16(dstPort))
+	binary.BigEndian.PutUint16(udp[4:6], uint16(udpLen))
+	binary.BigEndian.PutUint16(udp[6:8], 0) // checksum, filled below
+	copy(udp[8:], payload)
+	binary.BigEndian.PutUint16(udp[6:8], udpChecksum(srcIP4, dstIP4, udp))
+
+	return frame, nil
+}
+
+// ParseUDP4Frame parses an Ethernet frame carrying an IPv4/UDP datagram and
+// returns its addressing and payload. It does not validate checksums: a
+// corrupt frame, like any malformed DHCPv4 packet, is left for the caller
+// (dhcpv4.FromBytes) to reject.
+func ParseUDP4Frame(frame []byte) (srcMAC, dstMAC net.HardwareAddr, srcIP, dstIP net.IP, srcPort, dstPort int, payload []byte, err error) {
+	if len(frame) < minFrameLength {
+		return nil, nil, nil, nil, 0, 0, nil, ErrShortFrame
+	}
+	if binary.BigEndian.Uint16(frame[12:14]) != etherTypeIPv4 {
+		return nil, nil, nil, nil, 0, 0, nil, ErrNotUDP4
+	}
+	dstMAC = net.HardwareAddr(append([]byte(nil), frame[0:6]...))
+	srcMAC = net.HardwareAddr(append([]byte(nil), frame[6:12]...))
+
+	ip := frame[ethHeaderLen:]
+	ihl := int(ip[0]&0x0f) * 4
+	if ihl < ipv4HeaderLen || len(ip) < ihl+udpHeaderLen {
+		return nil, nil, nil, nil, 0, 0, nil, ErrShortFrame
+	}
+	if ip[9] != ipProtoUDP {
+		return nil, nil, nil, nil, 0, 0, nil, ErrNotUDP4
+	}
+	srcIP = net.IP(append([]byte(nil), ip[12:16]...))
+	dstIP = net.IP(append([]byte(nil), ip[16:20]...))
+
+	udp := ip[ihl:]
+	srcPort = int(binary.BigEndian.Uint16(udp[0:2]))
+	dstPort = int(binary.BigEndian.Uint16(udp[2:4]))
+	udpLen := int(binary.BigEndian.Uint16(udp[4:6]))
+	if udpLen < udpHeaderLen || len(udp) < udpLen {
+		return nil, nil, nil, nil, 0, 0, nil, ErrShortFrame
+	}
+	payload = udp[udpHeaderLen:udpLen]
+
+	return srcMAC, dstMAC, srcIP, dstIP, srcPort, dstPort, payload, nil
+}
+
+// checksum computes the IPv4 header checksum (RFC 791 §3.1).
+func checksum(b []byte) uint16 {
+	return finishChecksum(partialChecksum(0, b))
+}
+
+// udpChecksum computes the UDP checksum over the IPv4 pseudo-header, the
+// UDP header and payload (RFC 768).
+func udpChecksum(srcIP, dstIP net.IP, udp []byte) uint16 {
+	sum := partialChecksum(0, srcIP)
+	sum = partialChecksum(sum, dstIP)
+	pseudo := []byte{0, ipProtoUDP}
+	sum = partialChecksum(sum, pseudo)
+	var udpLen [2]byte
+	binary.BigEndian.PutUint16(udpLen[:], uint16(len(udp)))
+	sum = partialChecksum(sum, udpLen[:])
+	sum = partialChecksum(sum, udp)
+	return finishChecksum(sum)
+}
+
+func partialChecksum(sum uint32, b []byte) uint32 {
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i : i+2]))
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	return sum
+}
+
+func finishChecksum(sum uint32) uint16 {
+	for sum>>16 != 0 {
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+	return ^uint16(sum)
+}
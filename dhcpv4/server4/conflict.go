@@ -0,0 +1,135 @@
+package server4
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/ipv4"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+// ForeignServer describes a DHCPv4 server that answered a CheckOtherServers
+// probe.
+type ForeignServer struct {
+	// ServerID is the responder's option 54 (server identifier), if present.
+	ServerID net.IP
+	// OfferedIP is the yiaddr the responder offered.
+	OfferedIP net.IP
+	// Peer is the address the DHCPOFFER was received from.
+	Peer net.Addr
+}
+
+// ErrForeignDHCPServer is returned by a WithConflictCheck probe when one or
+// more DHCPv4 servers already answered on the segment.
+type ErrForeignDHCPServer struct {
+	Servers []ForeignServer
+}
+
+func (e *ErrForeignDHCPServer) Error() string {
+	ids := make([]string, 0, len(e.Servers))
+	for _, s := range e.Servers {
+		ids = append(ids, fmt.Sprintf("%s (offering %s)", s.ServerID, s.OfferedIP))
+	}
+	return fmt.Sprintf("server4: found %d other DHCP server(s) on the segment: %s", len(e.Servers), strings.Join(ids, ", "))
+}
+
+// WithConflictCheck runs CheckOtherServers against ifi during NewServer and
+// fails server construction with an *ErrForeignDHCPServer if any responses
+// come back within timeout. This mirrors the "check other DHCP servers"
+// safety check operators expect before an authoritative server starts
+// handing out leases on a segment that might already have one.
+func WithConflictCheck(ifi *net.Interface, timeout time.Duration) ServerOpt {
+	return func(s *Server) error {
+		servers, err := CheckOtherServers(ifi, timeout)
+		if err != nil {
+			return fmt.Errorf("server4: conflict check on %s: %w", ifi.Name, err)
+		}
+		if len(servers) > 0 {
+			return &ErrForeignDHCPServer{Servers: servers}
+		}
+		return nil
+	}
+}
+
+// CheckOtherServers broadcasts a DHCPDISCOVER with a randomized XID out ifi
+// and collects every DHCPOFFER received within timeout, returning one
+// ForeignServer per distinct responder. It uses golang.org/x/net/ipv4 rather
+// than a raw AF_PACKET socket, so it builds and runs on any unix target, not
+// just Linux.
+func CheckOtherServers(ifi *net.Interface, timeout time.Duration) ([]ForeignServer, error) {
+	conn, err := net.ListenPacket("udp4", fmt.Sprintf(":%d", clientPort))
+	if err != nil {
+		return nil, fmt.Errorf("listening on udp :%d: %w", clientPort, err)
+	}
+	defer conn.Close()
+
+	pc := ipv4.NewPacketConn(conn)
+	if err := pc.SetControlMessage(ipv4.FlagInterface, true); err != nil {
+		return nil, fmt.Errorf("enabling interface control messages: %w", err)
+	}
+
+	discover, err := newProbeDiscover(ifi.HardwareAddr)
+	if err != nil {
+		return nil, fmt.Errorf("building probe DISCOVER: %w", err)
+	}
+
+	dst := &net.UDPAddr{IP: net.IPv4bcast, Port: serverPort}
+	cm := &ipv4.ControlMessage{IfIndex: ifi.Index}
+	if _, err := pc.WriteTo(discover.ToBytes(), cm, dst); err != nil {
+		return nil, fmt.Errorf("sending probe DISCOVER on %s: %w", ifi.Name, err)
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var found []ForeignServer
+	buf := make([]byte, 4096)
+	for {
+		n, rcm, peer, err := pc.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			}
+			return nil, err
+		}
+		// The listener is bound to the wildcard address, since ifi may not
+		// have an IP configured yet to bind to; filter by ingress interface
+		// instead, so a reply arriving on some other segment isn't mistaken
+		// for one on ifi.
+		if rcm == nil || rcm.IfIndex != ifi.Index {
+			continue
+		}
+		m, err := dhcpv4.FromBytes(buf[:n])
+		if err != nil || m.MessageType() != dhcpv4.MessageTypeOffer || m.TransactionID != discover.TransactionID {
+			continue
+		}
+		sid := m.ServerIdentifier()
+		key := sid.String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		found = append(found, ForeignServer{
+			ServerID:  sid,
+			OfferedIP: m.YourIPAddr,
+			Peer:      peer,
+		})
+	}
+	return found, nil
+}
+
+// newProbeDiscover builds a minimal DHCPDISCOVER with a randomized XID,
+// suitable only for provoking a DHCPOFFER from any servers listening on the
+// segment; it is never meant to actually lease an address.
+func newProbeDiscover(mac net.HardwareAddr) (*dhcpv4.DHCPv4, error) {
+	xid, err := dhcpv4.GenerateTransactionID()
+	if err != nil {
+		return nil, err
+	}
+	return dhcpv4.NewDiscovery(mac, dhcpv4.WithTransactionID(xid))
+}
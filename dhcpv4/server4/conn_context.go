@@ -0,0 +1,89 @@
+package server4
+
+import (
+	"net"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+// ifAwarePacketConn is implemented by listeners that can report, for each
+// received packet, the ingress interface and the destination IP the client
+// sent to (e.g. a raw AF_PACKET/BPF socket, or a UDP socket with
+// IP_PKTINFO/IP_RECVIF enabled via golang.org/x/net/ipv4). Server.Serve type
+// -asserts s.conn against this interface to decide whether a *ServeContext
+// should be handed to the Handler instead of the bare conn.
+type ifAwarePacketConn interface {
+	net.PacketConn
+
+	// ReadFromIf behaves like ReadFrom, but also reports the interface the
+	// packet arrived on and the destination IP it was addressed to.
+	ReadFromIf(b []byte) (n int, peer net.Addr, ifi *net.Interface, dst net.IP, err error)
+}
+
+// ServeContext wraps a listener's net.PacketConn with the per-message
+// metadata made available by raw and IP_PKTINFO-aware listeners (see
+// WithRawConn and WithIPv4Conn). Handlers that need to know the ingress
+// interface or destination IP of a message -- for example to reply correctly
+// to a client that does not have an IP yet -- can type-assert the conn
+// argument they receive to *ServeContext.
+type ServeContext struct {
+	net.PacketConn
+
+	// Ifindex is the index of the interface the message was received on.
+	Ifindex int
+	// Ifname is the name of the interface the message was received on, if
+	// known.
+	Ifname string
+	// DestinationIP is the IP address the client addressed the message to,
+	// e.g. 255.255.255.255 for a broadcast DISCOVER.
+	DestinationIP net.IP
+}
+
+func ifIndex(ifi *net.Interface) int {
+	if ifi == nil {
+		return 0
+	}
+	return ifi.Index
+}
+
+func ifName(ifi *net.Interface) string {
+	if ifi == nil {
+		return ""
+	}
+	return ifi.Name
+}
+
+// Reply sends m to peer over conn, choosing between unicast and L2 broadcast
+// delivery the way a DHCPv4 server must: if peer already carries a routable
+// IP (i.e. the client sent from a non-zero address), or m does not have the
+// BROADCAST flag set, it is sent directly to peer. Otherwise, when conn is
+// a *ServeContext backed by a link-layer listener (WithRawConn), it is
+// broadcast at the link layer so it reaches clients that have no IP
+// configured yet; with any other conn it is still written to peer with
+// conn.WriteTo, not broadcast.
+func Reply(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4) error {
+	if sc, ok := conn.(*ServeContext); ok {
+		if bc, ok := sc.PacketConn.(broadcaster); ok && needsL2Broadcast(peer, m) {
+			return bc.WriteToBroadcast(m.ToBytes(), sc.Ifindex)
+		}
+	}
+	_, err := conn.WriteTo(m.ToBytes(), peer)
+	return err
+}
+
+// broadcaster is implemented by listeners that can send an L2 broadcast
+// frame out a specific interface, such as the raw AF_PACKET/BPF conn
+// returned by WithRawConn.
+type broadcaster interface {
+	WriteToBroadcast(b []byte, ifindex int) error
+}
+
+func needsL2Broadcast(peer net.Addr, m *dhcpv4.DHCPv4) bool {
+	if !m.IsBroadcast() {
+		return false
+	}
+	if u, ok := peer.(*net.UDPAddr); ok && u.IP != nil && !u.IP.IsUnspecified() {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package server4
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/net/ipv4"
+)
+
+// ipv4Conn wraps a UDP net.PacketConn with golang.org/x/net/ipv4.PacketConn,
+// using IP_PKTINFO to recover the ingress interface and destination IP of
+// each datagram. It implements ifAwarePacketConn so Server.Serve hands
+// handlers a *ServeContext carrying that metadata.
+type ipv4Conn struct {
+	net.PacketConn
+	pc *ipv4.PacketConn
+}
+
+// WithIPv4Conn wraps the server's UDP listener with an IP_PKTINFO-aware
+// golang.org/x/net/ipv4.PacketConn, so that Handlers receive a *ServeContext
+// reporting the ingress interface and destination IP of every message. This
+// is the portable alternative to WithRawConn: it works on any unix the
+// underlying UDP socket can be opened on, but -- unlike a raw socket -- it
+// can only reply to clients that already have a usable source address.
+//
+// It wraps the connection set by an earlier WithConn option. It does not
+// wrap the UDP listener NewServer opens from addr, since NewServer opens
+// that only after every option has run; without a prior WithConn it
+// returns an error.
+func WithIPv4Conn() ServerOpt {
+	return func(s *Server) error {
+		if s.conn == nil {
+			return fmt.Errorf("server4: WithIPv4Conn requires a connection set by an earlier WithConn option")
+		}
+		pc := ipv4.NewPacketConn(s.conn)
+		if err := pc.SetControlMessage(ipv4.FlagInterface|ipv4.FlagDst, true); err != nil {
+			return fmt.Errorf("server4: enabling IP_PKTINFO: %w", err)
+		}
+		s.conn = &ipv4Conn{PacketConn: s.conn, pc: pc}
+		return nil
+	}
+}
+
+// ReadFromIf implements ifAwarePacketConn.
+func (c *ipv4Conn) ReadFromIf(b []byte) (int, net.Addr, *net.Interface, net.IP, error) {
+	n, cm, peer, err := c.pc.ReadFrom(b)
+	if err != nil {
+		return n, peer, nil, nil, err
+	}
+	var ifi *net.Interface
+	var dst net.IP
+	if cm != nil {
+		dst = cm.Dst
+		if cm.IfIndex > 0 {
+			ifi, _ = net.InterfaceByIndex(cm.IfIndex)
+		}
+	}
+	return n, peer, ifi, dst, nil
+}
@@ -0,0 +1,148 @@
+//go:build unix
+
+package server4
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/insomniacslk/dhcp/dhcpv4/internal/rawconn"
+	"github.com/mdlayher/raw"
+)
+
+// rawConn listens for DHCPv4 traffic on an AF_PACKET/BPF raw socket, parsing
+// and building the full Ethernet/IPv4/UDP frame itself. Unlike a UDP socket,
+// it can reply to clients that have no IP configured yet, by broadcasting at
+// the link layer.
+type rawConn struct {
+	*raw.Conn // provides Close, LocalAddr and the SetXDeadline family
+	ifi       *net.Interface
+
+	// frame is the scratch buffer ReadFromIf reads a raw frame into before
+	// parsing and copying the DHCPv4 payload out of it. It is reused across
+	// calls instead of allocated per-packet; like client4.Client.readLoop's
+	// equivalent buffer, it assumes a single reader goroutine (Server.Serve
+	// never calls ReadFromIf concurrently with itself).
+	frame []byte
+
+	mu      sync.Mutex
+	peerMAC map[string]net.HardwareAddr // keyed by peer UDPAddr.String()
+}
+
+// WithRawConn opens an AF_PACKET (on Linux) or BPF (on other unix targets)
+// raw socket on ifi and configures the server to use it instead of a UDP
+// listener. This is the only way to correctly reply to a client that does
+// not yet have an IP address: the reply must be broadcast at the Ethernet
+// layer with the server's own source IP, which a regular UDP socket cannot
+// do.
+func WithRawConn(ifi *net.Interface) ServerOpt {
+	return func(s *Server) error {
+		c, err := raw.ListenPacket(ifi, etherTypeIPv4ProtoID, nil)
+		if err != nil {
+			return fmt.Errorf("server4: opening raw socket on %s: %w", ifi.Name, err)
+		}
+		s.conn = &rawConn{
+			Conn:    c,
+			ifi:     ifi,
+			frame:   make([]byte, 65536),
+			peerMAC: make(map[string]net.HardwareAddr),
+		}
+		return nil
+	}
+}
+
+// etherTypeIPv4ProtoID is the EtherType raw.ListenPacket filters for,
+// expressed as the uint16 mdlayher/raw expects (network byte order is
+// handled by the library).
+const etherTypeIPv4ProtoID = 0x0800
+
+// ReadFromIf implements ifAwarePacketConn.
+func (c *rawConn) ReadFromIf(b []byte) (int, net.Addr, *net.Interface, net.IP, error) {
+	for {
+		n, _, err := c.Conn.ReadFrom(c.frame)
+		if err != nil {
+			return 0, nil, nil, nil, err
+		}
+		srcMAC, _, srcIP, dstIP, srcPort, dstPort, payload, err := rawconn.ParseUDP4Frame(c.frame[:n])
+		if err != nil {
+			continue // not a UDP/IPv4 frame, e.g. ARP; keep reading
+		}
+		if dstPort != serverPort {
+			continue
+		}
+		peer := &net.UDPAddr{IP: srcIP, Port: srcPort}
+		c.mu.Lock()
+		c.peerMAC[peer.String()] = append(net.HardwareAddr(nil), srcMAC...)
+		c.mu.Unlock()
+
+		copied := copy(b, payload)
+		return copied, peer, c.ifi, dstIP, nil
+	}
+}
+
+// ReadFrom implements net.PacketConn by discarding the interface/destination
+// metadata that ReadFromIf reports.
+func (c *rawConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, peer, _, _, err := c.ReadFromIf(b)
+	return n, peer, err
+}
+
+// WriteTo implements net.PacketConn, unicasting to peer's MAC address if
+// known (recorded from a prior ReadFromIf), and falling back to broadcast
+// otherwise.
+func (c *rawConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	peer, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, fmt.Errorf("server4: rawConn.WriteTo: unsupported address type %T", addr)
+	}
+	c.mu.Lock()
+	dstMAC, ok := c.peerMAC[peer.String()]
+	c.mu.Unlock()
+	if !ok {
+		dstMAC = rawconn.EtherBroadcast
+	}
+	return c.writeFrame(b, dstMAC, peer.IP, peer.Port)
+}
+
+// WriteToBroadcast implements broadcaster: it sends b as an L2 and L3
+// broadcast out ifindex, which must match c.ifi.
+func (c *rawConn) WriteToBroadcast(b []byte, ifindex int) error {
+	_, err := c.writeFrame(b, rawconn.EtherBroadcast, net.IPv4bcast, clientPort)
+	return err
+}
+
+func (c *rawConn) writeFrame(payload []byte, dstMAC net.HardwareAddr, dstIP net.IP, dstPort int) (int, error) {
+	srcIP := interfaceIPv4(c.ifi)
+	frame, err := rawconn.BuildUDP4Frame(c.ifi.HardwareAddr, dstMAC, srcIP, dstIP, serverPort, dstPort, payload)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := c.Conn.WriteTo(frame, &raw.Addr{HardwareAddr: dstMAC}); err != nil {
+		return 0, err
+	}
+	return len(payload), nil
+}
+
+// interfaceIPv4 returns the first IPv4 address configured on ifi, or
+// net.IPv4zero if it has none yet -- which is the common case this listener
+// mode exists for.
+func interfaceIPv4(ifi *net.Interface) net.IP {
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return net.IPv4zero
+	}
+	for _, a := range addrs {
+		var ip net.IP
+		switch v := a.(type) {
+		case *net.IPNet:
+			ip = v.IP
+		case *net.IPAddr:
+			ip = v.IP
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4
+		}
+	}
+	return net.IPv4zero
+}
@@ -0,0 +1,154 @@
+package leases
+
+import (
+	"log"
+	"net"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv4/server4"
+)
+
+// Config bundles everything Handler needs to serve DHCPv4 requests on top of
+// a LeaseManager.
+type Config struct {
+	// Manager allocates and tracks leases. Required.
+	Manager LeaseManager
+	// ServerID is advertised as option 54 (server identifier) in every
+	// OFFER/ACK. Required.
+	ServerID net.IP
+	// Netmask is advertised as option 1 (subnet mask). Required.
+	Netmask net.IPMask
+}
+
+// Handler returns a server4.Handler that implements the full DHCPv4
+// allocation exchange -- DISCOVER/OFFER, REQUEST/ACK/NAK, RELEASE, DECLINE
+// and INFORM -- on top of cfg.Manager, so callers get a working server
+// out of the box instead of having to write the state machine themselves.
+func Handler(cfg Config) server4.Handler {
+	return server4.HandlerFunc(func(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4) {
+		var (
+			reply *dhcpv4.DHCPv4
+			err   error
+		)
+		switch m.MessageType() {
+		case dhcpv4.MessageTypeDiscover:
+			reply, err = handleDiscover(cfg, m)
+		case dhcpv4.MessageTypeRequest:
+			reply, err = handleRequest(cfg, m)
+		case dhcpv4.MessageTypeRelease:
+			err = cfg.Manager.Release(m.ClientHWAddr)
+		case dhcpv4.MessageTypeDecline:
+			err = cfg.Manager.Decline(m.ClientHWAddr, m.RequestedIPAddress())
+		case dhcpv4.MessageTypeInform:
+			reply, err = handleInform(cfg, m)
+		default:
+			return
+		}
+		if err != nil {
+			log.Printf("leases: handling %s from %s: %v", m.MessageType(), m.ClientHWAddr, err)
+			return
+		}
+		if reply == nil {
+			return
+		}
+		if _, err := conn.WriteTo(reply.ToBytes(), peer); err != nil {
+			log.Printf("leases: replying to %s: %v", peer, err)
+		}
+	})
+}
+
+func handleDiscover(cfg Config, m *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, error) {
+	lease, err := cfg.Manager.Allocate(m.ClientHWAddr, m.RequestedIPAddress(), ServerHint{RelayIP: m.GatewayIPAddr})
+	if err != nil {
+		return nil, err
+	}
+	pool := cfg.poolFor(lease)
+	return dhcpv4.NewReplyFromRequest(m,
+		dhcpv4.WithMessageType(dhcpv4.MessageTypeOffer),
+		dhcpv4.WithYourIP(lease.IP),
+		dhcpv4.WithServerIP(cfg.ServerID),
+		dhcpv4.WithNetmask(cfg.Netmask),
+		dhcpv4.WithOption(dhcpv4.OptServerIdentifier(cfg.ServerID)),
+		dhcpv4.WithLeaseTime(uint32(pool.leaseTime().Seconds())),
+		withPoolOptions(pool),
+	)
+}
+
+func handleRequest(cfg Config, m *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, error) {
+	if sid := m.ServerIdentifier(); sid != nil && !sid.Equal(cfg.ServerID) {
+		// The client selected a different server's OFFER (RFC 2131 §4.3.2);
+		// we must stay silent rather than NAK a REQUEST we were never
+		// offered against.
+		return nil, nil
+	}
+	lease, ok, err := cfg.Manager.Lookup(m.ClientHWAddr)
+	if err != nil {
+		return nil, err
+	}
+	requested := m.RequestedIPAddress()
+	if requested == nil {
+		requested = m.ClientIPAddr
+	}
+	if !ok || !lease.IP.Equal(requested) {
+		return dhcpv4.NewReplyFromRequest(m,
+			dhcpv4.WithMessageType(dhcpv4.MessageTypeNak),
+			dhcpv4.WithServerIP(cfg.ServerID),
+			dhcpv4.WithOption(dhcpv4.OptServerIdentifier(cfg.ServerID)),
+		)
+	}
+	lease, err = cfg.Manager.Renew(m.ClientHWAddr)
+	if err != nil {
+		return nil, err
+	}
+	pool := cfg.poolFor(lease)
+	return dhcpv4.NewReplyFromRequest(m,
+		dhcpv4.WithMessageType(dhcpv4.MessageTypeAck),
+		dhcpv4.WithYourIP(lease.IP),
+		dhcpv4.WithServerIP(cfg.ServerID),
+		dhcpv4.WithNetmask(cfg.Netmask),
+		dhcpv4.WithOption(dhcpv4.OptServerIdentifier(cfg.ServerID)),
+		dhcpv4.WithLeaseTime(uint32(pool.leaseTime().Seconds())),
+		withPoolOptions(pool),
+	)
+}
+
+func handleInform(cfg Config, m *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, error) {
+	pool := cfg.poolFor(nil)
+	return dhcpv4.NewReplyFromRequest(m,
+		dhcpv4.WithMessageType(dhcpv4.MessageTypeAck),
+		dhcpv4.WithServerIP(cfg.ServerID),
+		dhcpv4.WithOption(dhcpv4.OptServerIdentifier(cfg.ServerID)),
+		withPoolOptions(pool),
+	)
+}
+
+// poolFor returns the Pool a lease was allocated from, or the first
+// configured pool as a fallback for messages (like INFORM) with no lease.
+func (cfg Config) poolFor(l *Lease) *Pool {
+	mgr, ok := cfg.Manager.(*Manager)
+	if !ok || len(mgr.pools) == 0 {
+		return &Pool{}
+	}
+	if l != nil {
+		if p := mgr.poolByName(l.Pool); p != nil {
+			return p
+		}
+	}
+	return mgr.pools[0]
+}
+
+// withPoolOptions is a dhcpv4.Modifier that merges in a Pool's configured
+// options (router, DNS, domain, NTP, PXE next-server/boot-file).
+func withPoolOptions(p *Pool) dhcpv4.Modifier {
+	return func(d *dhcpv4.DHCPv4) {
+		for code, v := range p.options() {
+			d.Options.Update(dhcpv4.OptGeneric(dhcpv4.GenericOptionCode(code), v))
+		}
+		if p.NextServer != nil {
+			d.ServerIPAddr = p.NextServer
+		}
+		if p.BootFile != "" {
+			d.BootFileName = p.BootFile
+		}
+	}
+}
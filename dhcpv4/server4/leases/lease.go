@@ -0,0 +1,69 @@
+// Package leases implements a pluggable DHCPv4 lease allocator: a
+// LeaseManager that hands out, renews and tracks leases against one or more
+// Pools, backed by a configurable Store, plus a ready-to-use server4.Handler
+// that drives the manager through the full DISCOVER/OFFER/REQUEST/ACK/NAK/
+// RELEASE/DECLINE/INFORM exchange.
+package leases
+
+import (
+	"net"
+	"time"
+)
+
+// Lease represents a single address assignment to a client, identified by
+// its hardware address.
+type Lease struct {
+	IP       net.IP
+	MAC      net.HardwareAddr
+	Hostname string
+	Pool     string // name of the Pool the lease was allocated from
+	Expiry   time.Time
+	Static   bool // true for a static reservation; never expires, never reassigned
+}
+
+// Expired reports whether the lease had already expired at t.
+func (l *Lease) Expired(t time.Time) bool {
+	if l.Static {
+		return false
+	}
+	return t.After(l.Expiry)
+}
+
+// ServerHint carries allocation-time context a LeaseManager can use to pick
+// the right Pool when more than one is configured.
+type ServerHint struct {
+	// RelayIP is the DHCPv4 giaddr, set when the request was forwarded by a
+	// relay agent. A zero IP means the client is on a directly attached
+	// segment. Manager uses it to prefer the Pool whose Subnet contains it,
+	// so a relayed DISCOVER lands in the pool that actually serves that
+	// segment instead of whichever pool happens to have a free address
+	// first.
+	RelayIP net.IP
+}
+
+// LeaseManager allocates, renews and tracks leases. Implementations are
+// expected to be safe for concurrent use.
+type LeaseManager interface {
+	// Allocate returns a lease for mac, preferring requested if it is free
+	// and within a configured Pool. If mac already holds a lease, Allocate
+	// returns it unchanged (callers wanting a fresh lease should Release
+	// first).
+	Allocate(mac net.HardwareAddr, requested net.IP, hint ServerHint) (*Lease, error)
+
+	// Renew extends the expiry of mac's existing lease and returns it. It
+	// returns ErrNoLease if mac holds no lease.
+	Renew(mac net.HardwareAddr) (*Lease, error)
+
+	// Release gives up mac's lease, if any, making its IP available for
+	// reallocation once released. Releasing a lease that does not exist is
+	// not an error.
+	Release(mac net.HardwareAddr) error
+
+	// Decline marks ip as unusable for lease allocation, e.g. because a
+	// client reported an address conflict for it. mac identifies the client
+	// that declined it.
+	Decline(mac net.HardwareAddr, ip net.IP) error
+
+	// Lookup returns mac's current lease, if any.
+	Lookup(mac net.HardwareAddr) (*Lease, bool, error)
+}
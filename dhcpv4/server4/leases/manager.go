@@ -0,0 +1,242 @@
+package leases
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Manager is the default LeaseManager: it allocates from a fixed list of
+// Pools, persisting state to a Store. Pools are tried in order, with any
+// pool matching ServerHint.RelayIP moved to the front: a static reservation
+// for the MAC in any of them wins; failing that, the first pool with a free
+// address is used.
+type Manager struct {
+	mu    sync.Mutex
+	pools []*Pool
+	store Store
+	now   func() time.Time // overridable for tests
+}
+
+// NewManager returns a Manager allocating from pools and persisting leases
+// to store. If store is nil, a MemoryStore is used.
+func NewManager(store Store, pools ...*Pool) *Manager {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	return &Manager{
+		pools: pools,
+		store: store,
+		now:   time.Now,
+	}
+}
+
+// Allocate implements LeaseManager.
+func (m *Manager) Allocate(mac net.HardwareAddr, requested net.IP, hint ServerHint) (*Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if l, err := m.store.Get(mac); err == nil {
+		if !l.Expired(m.now()) {
+			return l, nil
+		}
+		// The existing lease has expired: fall through and treat mac as
+		// having none, so its old address is free to be reallocated (to
+		// mac itself or to anyone else) below.
+	} else if err != ErrNoLease {
+		return nil, err
+	}
+
+	pools := m.poolsForHint(hint)
+
+	for _, p := range pools {
+		if ip, ok := p.reservation(mac); ok {
+			l := &Lease{IP: ip, MAC: mac, Pool: p.Name, Static: true}
+			if err := m.store.Put(l); err != nil {
+				return nil, err
+			}
+			return l, nil
+		}
+	}
+
+	taken, err := m.takenIPs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range pools {
+		var ip net.IP
+		if requested != nil && p.availableForDynamicAlloc(requested) && !taken[requested.String()] {
+			ip = requested
+		} else {
+			ip = p.firstFree(taken)
+		}
+		if ip == nil {
+			continue
+		}
+		l := &Lease{
+			IP:     ip,
+			MAC:    mac,
+			Pool:   p.Name,
+			Expiry: m.now().Add(p.leaseTime()),
+		}
+		if err := m.store.Put(l); err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+	return nil, fmt.Errorf("leases: no free address for %s", mac)
+}
+
+// Renew implements LeaseManager.
+func (m *Manager) Renew(mac net.HardwareAddr) (*Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, err := m.store.Get(mac)
+	if err != nil {
+		return nil, err
+	}
+	if l.Expired(m.now()) {
+		// mac's address may already have been reassigned to someone else by
+		// Allocate; resurrecting this record would hand mac a second live
+		// lease for an IP another client now legitimately holds.
+		return nil, ErrNoLease
+	}
+	if !l.Static {
+		pool := m.poolByName(l.Pool)
+		dur := DefaultLeaseTime
+		if pool != nil {
+			dur = pool.leaseTime()
+		}
+		l.Expiry = m.now().Add(dur)
+		if err := m.store.Put(l); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// Release implements LeaseManager.
+func (m *Manager) Release(mac net.HardwareAddr) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.store.Delete(mac)
+}
+
+// Decline implements LeaseManager by dropping the lease and adding ip to its
+// pool's exclusion list, so it will not be handed out again until the
+// exclusion is removed by the operator.
+func (m *Manager) Decline(mac net.HardwareAddr, ip net.IP) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.store.Delete(mac); err != nil {
+		return err
+	}
+	for _, p := range m.pools {
+		if p.contains(ip) {
+			p.Exclusions = append(p.Exclusions, ip)
+			break
+		}
+	}
+	return nil
+}
+
+// Lookup implements LeaseManager.
+func (m *Manager) Lookup(mac net.HardwareAddr) (*Lease, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, err := m.store.Get(mac)
+	if err == ErrNoLease {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if l.Expired(m.now()) {
+		return nil, false, nil
+	}
+	return l, true, nil
+}
+
+// poolsForHint returns m.pools ordered so that any pool whose Subnet
+// contains hint.RelayIP is tried first, preserving configured order among
+// the rest. A relayed DISCOVER (non-zero giaddr) is thus served from the
+// pool matching its segment instead of whichever pool happens to have a
+// free address first; a directly attached request (zero RelayIP) leaves
+// the configured order untouched.
+func (m *Manager) poolsForHint(hint ServerHint) []*Pool {
+	if hint.RelayIP == nil || hint.RelayIP.IsUnspecified() {
+		return m.pools
+	}
+	ordered := make([]*Pool, 0, len(m.pools))
+	var rest []*Pool
+	for _, p := range m.pools {
+		if p.Subnet != nil && p.Subnet.Contains(hint.RelayIP) {
+			ordered = append(ordered, p)
+		} else {
+			rest = append(rest, p)
+		}
+	}
+	return append(ordered, rest...)
+}
+
+func (m *Manager) poolByName(name string) *Pool {
+	for _, p := range m.pools {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// takenIPs returns the set of IPs currently leased, keyed by String(),
+// excluding expired ones.
+func (m *Manager) takenIPs() (map[string]bool, error) {
+	ls, err := m.store.List()
+	if err != nil {
+		return nil, err
+	}
+	taken := make(map[string]bool, len(ls))
+	now := m.now()
+	for _, l := range ls {
+		if l.Expired(now) {
+			continue
+		}
+		taken[l.IP.String()] = true
+	}
+	return taken, nil
+}
+
+// firstFree returns the first address in the pool's range not in taken, or
+// nil if the pool is exhausted.
+func (p *Pool) firstFree(taken map[string]bool) net.IP {
+	ip := cloneIP(p.RangeStart.To4())
+	end := p.RangeEnd.To4()
+	for {
+		if !taken[ip.String()] && p.availableForDynamicAlloc(ip) {
+			return cloneIP(ip)
+		}
+		if ip.Equal(end) {
+			return nil
+		}
+		incIP(ip)
+	}
+}
+
+func cloneIP(ip net.IP) net.IP {
+	out := make(net.IP, len(ip))
+	copy(out, ip)
+	return out
+}
+
+func incIP(ip net.IP) {
+	ip4 := ip.To4()
+	for i := len(ip4) - 1; i >= 0; i-- {
+		ip4[i]++
+		if ip4[i] != 0 {
+			break
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package leases
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func mustMAC(t *testing.T, s string) net.HardwareAddr {
+	t.Helper()
+	mac, err := net.ParseMAC(s)
+	if err != nil {
+		t.Fatalf("ParseMAC(%q): %v", s, err)
+	}
+	return mac
+}
+
+func newTestPool(name string, start, end string) *Pool {
+	return &Pool{
+		Name:         name,
+		RangeStart:   net.ParseIP(start),
+		RangeEnd:     net.ParseIP(end),
+		Reservations: map[string]net.IP{},
+		LeaseTime:    time.Hour,
+	}
+}
+
+func newTestManager(pools ...*Pool) *Manager {
+	m := NewManager(NewMemoryStore(), pools...)
+	m.now = time.Now
+	return m
+}
+
+func TestAllocateAssignsFromRange(t *testing.T) {
+	m := newTestManager(newTestPool("p1", "192.168.1.10", "192.168.1.12"))
+	mac := mustMAC(t, "aa:bb:cc:dd:ee:01")
+
+	l, err := m.Allocate(mac, nil, ServerHint{})
+	if err != nil {
+		t.Fatalf("Allocate: %v", err)
+	}
+	if !l.IP.Equal(net.ParseIP("192.168.1.10")) {
+		t.Fatalf("got IP %s, want 192.168.1.10", l.IP)
+	}
+
+	// A second Allocate for the same MAC returns the same lease, not a new
+	// address.
+	l2, err := m.Allocate(mac, nil, ServerHint{})
+	if err != nil {
+		t.Fatalf("second Allocate: %v", err)
+	}
+	if !l2.IP.Equal(l.IP) {
+		t.Fatalf("second Allocate returned %s, want %s (same lease)", l2.IP, l.IP)
+	}
+}
+
+func TestAllocateReallocatesExpiredLease(t *testing.T) {
+	pool := newTestPool("p1", "192.168.1.10", "192.168.1.10") // single address
+	m := newTestManager(pool)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	macA := mustMAC(t, "aa:bb:cc:dd:ee:01")
+	macB := mustMAC(t, "aa:bb:cc:dd:ee:02")
+
+	leaseA, err := m.Allocate(macA, nil, ServerHint{})
+	if err != nil {
+		t.Fatalf("Allocate A: %v", err)
+	}
+	if !leaseA.IP.Equal(net.ParseIP("192.168.1.10")) {
+		t.Fatalf("A got %s, want 192.168.1.10", leaseA.IP)
+	}
+
+	// Advance the clock past A's lease expiry.
+	now = now.Add(2 * time.Hour)
+
+	leaseB, err := m.Allocate(macB, net.ParseIP("192.168.1.10"), ServerHint{})
+	if err != nil {
+		t.Fatalf("Allocate B after A's lease expired: %v", err)
+	}
+	if !leaseB.IP.Equal(net.ParseIP("192.168.1.10")) {
+		t.Fatalf("B got %s, want the now-expired 192.168.1.10", leaseB.IP)
+	}
+
+	// A re-discovering must not get back the stale lease record for the
+	// address B now holds.
+	if _, err := m.Allocate(macA, nil, ServerHint{}); err == nil {
+		t.Fatalf("Allocate A after its lease expired and the address was reassigned to B: want error (pool exhausted), got none")
+	}
+}
+
+func TestAllocateSkipsReservationForOtherMAC(t *testing.T) {
+	pool := newTestPool("p1", "192.168.1.10", "192.168.1.10") // single address, reserved
+	macC := mustMAC(t, "aa:bb:cc:dd:ee:03")
+	pool.Reservations[macC.String()] = net.ParseIP("192.168.1.10")
+	m := newTestManager(pool)
+
+	macD := mustMAC(t, "aa:bb:cc:dd:ee:04")
+	if _, err := m.Allocate(macD, nil, ServerHint{}); err == nil {
+		t.Fatalf("Allocate D: want error (sole address reserved for C), got a lease")
+	}
+
+	// The reservation holder still gets its address.
+	leaseC, err := m.Allocate(macC, nil, ServerHint{})
+	if err != nil {
+		t.Fatalf("Allocate C: %v", err)
+	}
+	if !leaseC.IP.Equal(net.ParseIP("192.168.1.10")) || !leaseC.Static {
+		t.Fatalf("C got %+v, want static lease for 192.168.1.10", leaseC)
+	}
+}
+
+func TestAllocateSkipsReservedRequestedIP(t *testing.T) {
+	pool := newTestPool("p1", "192.168.1.10", "192.168.1.11")
+	macC := mustMAC(t, "aa:bb:cc:dd:ee:03")
+	pool.Reservations[macC.String()] = net.ParseIP("192.168.1.10")
+	m := newTestManager(pool)
+
+	macD := mustMAC(t, "aa:bb:cc:dd:ee:04")
+	l, err := m.Allocate(macD, net.ParseIP("192.168.1.10"), ServerHint{})
+	if err != nil {
+		t.Fatalf("Allocate D: %v", err)
+	}
+	if l.IP.Equal(net.ParseIP("192.168.1.10")) {
+		t.Fatalf("D was handed C's reserved address 192.168.1.10")
+	}
+	if !l.IP.Equal(net.ParseIP("192.168.1.11")) {
+		t.Fatalf("D got %s, want the only other free address 192.168.1.11", l.IP)
+	}
+}
+
+func TestDeclineExcludesIP(t *testing.T) {
+	pool := newTestPool("p1", "192.168.1.10", "192.168.1.10") // single address
+	m := newTestManager(pool)
+	mac := mustMAC(t, "aa:bb:cc:dd:ee:01")
+
+	lease, err := m.Allocate(mac, nil, ServerHint{})
+	if err != nil {
+		t.Fatalf("Allocate: %v", err)
+	}
+	if err := m.Decline(mac, lease.IP); err != nil {
+		t.Fatalf("Decline: %v", err)
+	}
+
+	if _, ok, err := m.Lookup(mac); err != nil || ok {
+		t.Fatalf("Lookup after Decline: ok=%v err=%v, want no lease on record", ok, err)
+	}
+
+	// The declined address must not be handed out again.
+	other := mustMAC(t, "aa:bb:cc:dd:ee:02")
+	if _, err := m.Allocate(other, nil, ServerHint{}); err == nil {
+		t.Fatalf("Allocate after Decline: want error (sole address excluded), got a lease")
+	}
+}
+
+func TestRenewRejectsExpiredLease(t *testing.T) {
+	pool := newTestPool("p1", "192.168.1.10", "192.168.1.10") // single address
+	m := newTestManager(pool)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	macA := mustMAC(t, "aa:bb:cc:dd:ee:01")
+	macB := mustMAC(t, "aa:bb:cc:dd:ee:02")
+
+	if _, err := m.Allocate(macA, nil, ServerHint{}); err != nil {
+		t.Fatalf("Allocate A: %v", err)
+	}
+
+	now = now.Add(2 * time.Hour) // past A's lease expiry
+
+	leaseB, err := m.Allocate(macB, net.ParseIP("192.168.1.10"), ServerHint{})
+	if err != nil {
+		t.Fatalf("Allocate B after A's lease expired: %v", err)
+	}
+
+	// A's record is stale: Renew must refuse to resurrect it now that the
+	// address belongs to B.
+	if _, err := m.Renew(macA); err != ErrNoLease {
+		t.Fatalf("Renew(macA) after reassignment to B: got err=%v, want ErrNoLease", err)
+	}
+	if l, ok, err := m.Lookup(macB); err != nil || !ok || !l.IP.Equal(leaseB.IP) {
+		t.Fatalf("Lookup(macB) after Renew(macA): l=%+v ok=%v err=%v, want B's lease intact", l, ok, err)
+	}
+}
+
+func TestAllocatePrefersPoolMatchingRelayIP(t *testing.T) {
+	_, subnetA, err := net.ParseCIDR("192.168.1.0/24")
+	if err != nil {
+		t.Fatalf("ParseCIDR: %v", err)
+	}
+	_, subnetB, err := net.ParseCIDR("192.168.2.0/24")
+	if err != nil {
+		t.Fatalf("ParseCIDR: %v", err)
+	}
+	poolA := newTestPool("a", "192.168.1.10", "192.168.1.10")
+	poolA.Subnet = subnetA
+	poolB := newTestPool("b", "192.168.2.10", "192.168.2.10")
+	poolB.Subnet = subnetB
+
+	// poolA is configured first, so a directly attached client (no hint)
+	// would ordinarily be served from it; a relayed request from subnet B
+	// must still land in poolB.
+	m := newTestManager(poolA, poolB)
+	mac := mustMAC(t, "aa:bb:cc:dd:ee:01")
+
+	l, err := m.Allocate(mac, nil, ServerHint{RelayIP: net.ParseIP("192.168.2.1")})
+	if err != nil {
+		t.Fatalf("Allocate: %v", err)
+	}
+	if l.Pool != "b" {
+		t.Fatalf("Allocate with RelayIP in subnet B returned pool %q, want %q", l.Pool, "b")
+	}
+}
+
+func TestRenewExtendsExpiry(t *testing.T) {
+	pool := newTestPool("p1", "192.168.1.10", "192.168.1.10")
+	m := newTestManager(pool)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	mac := mustMAC(t, "aa:bb:cc:dd:ee:01")
+	lease, err := m.Allocate(mac, nil, ServerHint{})
+	if err != nil {
+		t.Fatalf("Allocate: %v", err)
+	}
+	firstExpiry := lease.Expiry
+
+	now = now.Add(30 * time.Minute)
+	renewed, err := m.Renew(mac)
+	if err != nil {
+		t.Fatalf("Renew: %v", err)
+	}
+	if !renewed.Expiry.After(firstExpiry) {
+		t.Fatalf("Renew did not extend expiry: first=%v renewed=%v", firstExpiry, renewed.Expiry)
+	}
+}
@@ -0,0 +1,126 @@
+package leases
+
+import (
+	"bytes"
+	"net"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+// DefaultLeaseTime is used for a Pool that does not set LeaseTime.
+const DefaultLeaseTime = 12 * time.Hour
+
+// Pool describes one block of addresses a Manager can allocate from, along
+// with the DHCP options to hand out with it.
+type Pool struct {
+	// Name identifies the pool, e.g. for logging and for Lease.Pool. It does
+	// not need to be unique, but doing so makes lookups by name easier for
+	// callers.
+	Name string
+
+	// RangeStart and RangeEnd bound the addresses available for dynamic
+	// allocation, inclusive. Both must be within Subnet.
+	Subnet     *net.IPNet
+	RangeStart net.IP
+	RangeEnd   net.IP
+
+	// Reservations maps a MAC address (net.HardwareAddr.String()) to the IP
+	// it is always offered, bypassing dynamic allocation.
+	Reservations map[string]net.IP
+
+	// Exclusions lists addresses within the range that must never be
+	// allocated, e.g. statically configured infrastructure.
+	Exclusions []net.IP
+
+	// LeaseTime is handed out as option 51 and used to compute Lease.Expiry.
+	// Defaults to DefaultLeaseTime.
+	LeaseTime time.Duration
+	// MaxLeaseTime is a maximum lease duration, defaulting to LeaseTime.
+	// Manager and Handler do not consult it: every lease is granted for
+	// LeaseTime, and a lease time a client requests via option 51 is
+	// ignored.
+	MaxLeaseTime time.Duration
+
+	// Router, DNS, Domain and NTP populate the corresponding DHCP options
+	// (3, 6, 15, 42) on every OFFER/ACK from this pool, when set.
+	Router []net.IP
+	DNS    []net.IP
+	Domain string
+	NTP    []net.IP
+
+	// NextServer and BootFile populate the siaddr and file (boot file name)
+	// header fields, for network-booting clients. Option 67 is not set.
+	NextServer net.IP
+	BootFile   string
+}
+
+func (p *Pool) leaseTime() time.Duration {
+	if p.LeaseTime > 0 {
+		return p.LeaseTime
+	}
+	return DefaultLeaseTime
+}
+
+func (p *Pool) maxLeaseTime() time.Duration {
+	if p.MaxLeaseTime > 0 {
+		return p.MaxLeaseTime
+	}
+	return p.leaseTime()
+}
+
+// reservation returns the statically reserved IP for mac, if any.
+func (p *Pool) reservation(mac net.HardwareAddr) (net.IP, bool) {
+	ip, ok := p.Reservations[mac.String()]
+	return ip, ok
+}
+
+// contains reports whether ip falls within the pool's range and is not
+// excluded.
+func (p *Pool) contains(ip net.IP) bool {
+	if ip == nil || bytes.Compare(ip.To4(), p.RangeStart.To4()) < 0 || bytes.Compare(ip.To4(), p.RangeEnd.To4()) > 0 {
+		return false
+	}
+	for _, ex := range p.Exclusions {
+		if ex.Equal(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// reserved reports whether ip is a static reservation for some MAC. Callers
+// allocating dynamically must skip such addresses: a reservation holder
+// that hasn't connected yet still owns its address.
+func (p *Pool) reserved(ip net.IP) bool {
+	for _, resIP := range p.Reservations {
+		if resIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// availableForDynamicAlloc reports whether ip is in range, not excluded, and
+// not set aside by a static reservation for some other MAC.
+func (p *Pool) availableForDynamicAlloc(ip net.IP) bool {
+	return p.contains(ip) && !p.reserved(ip)
+}
+
+// options returns the DHCP options this pool contributes to an OFFER/ACK.
+func (p *Pool) options() dhcpv4.Options {
+	opts := make(dhcpv4.Options)
+	if len(p.Router) > 0 {
+		opts.Update(dhcpv4.OptRouter(p.Router...))
+	}
+	if len(p.DNS) > 0 {
+		opts.Update(dhcpv4.OptDNS(p.DNS...))
+	}
+	if p.Domain != "" {
+		opts.Update(dhcpv4.OptDomainName(p.Domain))
+	}
+	if len(p.NTP) > 0 {
+		opts.Update(dhcpv4.OptNTPServers(p.NTP...))
+	}
+	return opts
+}
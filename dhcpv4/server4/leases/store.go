@@ -0,0 +1,35 @@
+package leases
+
+import (
+	"errors"
+	"net"
+)
+
+// ErrNoLease is returned by a Store or LeaseManager when no lease is on
+// record for the requested MAC address.
+var ErrNoLease = errors.New("leases: no lease on record")
+
+// Store persists leases. Manager is the only intended caller; Store
+// implementations do not need to know about Pools or allocation policy, only
+// how to save, fetch and enumerate Lease records.
+//
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Get returns the lease recorded for mac, or ErrNoLease if there is
+	// none.
+	Get(mac net.HardwareAddr) (*Lease, error)
+
+	// GetByIP returns the lease recorded for ip, or ErrNoLease if there is
+	// none.
+	GetByIP(ip net.IP) (*Lease, error)
+
+	// Put saves (or overwrites) the lease for l.MAC.
+	Put(l *Lease) error
+
+	// Delete removes any lease recorded for mac. Deleting a MAC with no
+	// recorded lease is not an error.
+	Delete(mac net.HardwareAddr) error
+
+	// List returns every lease currently on record, in no particular order.
+	List() ([]*Lease, error)
+}
@@ -0,0 +1,126 @@
+package leases
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var leasesBucket = []byte("leases")
+
+// BoltStore is a Store backed by a BoltDB file, for deployments that need
+// leases to survive a restart without running a separate database. Leases
+// are keyed by MAC address; GetByIP falls back to a full bucket scan, since
+// Bolt has no secondary indexes.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens (creating if necessary) a BoltDB file at path for
+// lease storage.
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("leases: opening bolt db %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(leasesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("leases: initializing bolt db %s: %w", path, err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// Close closes the underlying BoltDB file.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// Get implements Store.
+func (s *BoltStore) Get(mac net.HardwareAddr) (*Lease, error) {
+	var l Lease
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(leasesBucket).Get([]byte(mac.String()))
+		if v == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(v, &l)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNoLease
+	}
+	return &l, nil
+}
+
+// GetByIP implements Store by scanning every recorded lease, since BoltDB
+// offers no secondary index on IP.
+func (s *BoltStore) GetByIP(ip net.IP) (*Lease, error) {
+	var found *Lease
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(leasesBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var l Lease
+			if err := json.Unmarshal(v, &l); err != nil {
+				return err
+			}
+			if l.IP.Equal(ip) {
+				found = &l
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, ErrNoLease
+	}
+	return found, nil
+}
+
+// Put implements Store.
+func (s *BoltStore) Put(l *Lease) error {
+	v, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(leasesBucket).Put([]byte(l.MAC.String()), v)
+	})
+}
+
+// Delete implements Store.
+func (s *BoltStore) Delete(mac net.HardwareAddr) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(leasesBucket).Delete([]byte(mac.String()))
+	})
+}
+
+// List implements Store.
+func (s *BoltStore) List() ([]*Lease, error) {
+	var out []*Lease
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(leasesBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			l := new(Lease)
+			if err := json.Unmarshal(v, l); err != nil {
+				return err
+			}
+			out = append(out, l)
+		}
+		return nil
+	})
+	return out, err
+}
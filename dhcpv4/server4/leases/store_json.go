@@ -0,0 +1,103 @@
+package leases
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+)
+
+// JSONFileStore is a Store that keeps leases in memory and persists the
+// full set to a JSON file on every write. It trades write performance for
+// simplicity and human-readable/editable state; for higher write volume use
+// BoltStore instead.
+type JSONFileStore struct {
+	path string
+
+	mu    sync.Mutex
+	inner *MemoryStore
+}
+
+// jsonLease is the on-disk representation of a Lease. net.IP marshals as a
+// dotted string, net.HardwareAddr as the base64 of its bytes, and time.Time
+// as RFC 3339 with enough precision to round-trip, so Lease can be encoded
+// directly.
+type jsonLease = Lease
+
+// NewJSONFileStore loads leases from path, creating it on first Put if it
+// does not yet exist.
+func NewJSONFileStore(path string) (*JSONFileStore, error) {
+	s := &JSONFileStore{path: path, inner: NewMemoryStore()}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("leases: opening %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var ls []*jsonLease
+	if err := json.NewDecoder(f).Decode(&ls); err != nil {
+		return nil, fmt.Errorf("leases: decoding %s: %w", path, err)
+	}
+	for _, l := range ls {
+		if err := s.inner.Put(l); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Get implements Store.
+func (s *JSONFileStore) Get(mac net.HardwareAddr) (*Lease, error) { return s.inner.Get(mac) }
+
+// GetByIP implements Store.
+func (s *JSONFileStore) GetByIP(ip net.IP) (*Lease, error) { return s.inner.GetByIP(ip) }
+
+// List implements Store.
+func (s *JSONFileStore) List() ([]*Lease, error) { return s.inner.List() }
+
+// Put implements Store, persisting the full lease set to disk afterwards.
+func (s *JSONFileStore) Put(l *Lease) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.inner.Put(l); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+// Delete implements Store, persisting the full lease set to disk afterwards.
+func (s *JSONFileStore) Delete(mac net.HardwareAddr) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.inner.Delete(mac); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+// flush rewrites the whole file. Callers must hold s.mu.
+func (s *JSONFileStore) flush() error {
+	ls, err := s.inner.List()
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("leases: creating %s: %w", tmp, err)
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(ls); err != nil {
+		f.Close()
+		return fmt.Errorf("leases: encoding %s: %w", tmp, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
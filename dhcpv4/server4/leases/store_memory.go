@@ -0,0 +1,78 @@
+package leases
+
+import (
+	"net"
+	"sync"
+)
+
+// MemoryStore is a Store backed by an in-memory map. Leases do not survive a
+// process restart. It is the default Store used when none is configured.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	byMAC map[string]*Lease
+	byIP  map[string]*Lease
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		byMAC: make(map[string]*Lease),
+		byIP:  make(map[string]*Lease),
+	}
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(mac net.HardwareAddr) (*Lease, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	l, ok := s.byMAC[mac.String()]
+	if !ok {
+		return nil, ErrNoLease
+	}
+	return l, nil
+}
+
+// GetByIP implements Store.
+func (s *MemoryStore) GetByIP(ip net.IP) (*Lease, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	l, ok := s.byIP[ip.String()]
+	if !ok {
+		return nil, ErrNoLease
+	}
+	return l, nil
+}
+
+// Put implements Store.
+func (s *MemoryStore) Put(l *Lease) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.byMAC[l.MAC.String()]; ok && !old.IP.Equal(l.IP) && s.byIP[old.IP.String()] == old {
+		delete(s.byIP, old.IP.String())
+	}
+	s.byMAC[l.MAC.String()] = l
+	s.byIP[l.IP.String()] = l
+	return nil
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(mac net.HardwareAddr) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.byMAC[mac.String()]; ok && s.byIP[l.IP.String()] == l {
+		delete(s.byIP, l.IP.String())
+	}
+	delete(s.byMAC, mac.String())
+	return nil
+}
+
+// List implements Store.
+func (s *MemoryStore) List() ([]*Lease, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*Lease, 0, len(s.byMAC))
+	for _, l := range s.byMAC {
+		out = append(out, l)
+	}
+	return out, nil
+}
@@ -0,0 +1,31 @@
+package leases
+
+import (
+	"net"
+	"testing"
+)
+
+func TestMemoryStorePutDropsStaleIPIndex(t *testing.T) {
+	s := NewMemoryStore()
+	mac := mustMAC(t, "aa:bb:cc:dd:ee:01")
+	oldIP := net.ParseIP("192.168.1.10")
+	newIP := net.ParseIP("192.168.1.11")
+
+	if err := s.Put(&Lease{IP: oldIP, MAC: mac}); err != nil {
+		t.Fatalf("Put(oldIP): %v", err)
+	}
+	if err := s.Put(&Lease{IP: newIP, MAC: mac}); err != nil {
+		t.Fatalf("Put(newIP): %v", err)
+	}
+
+	if _, err := s.GetByIP(oldIP); err != ErrNoLease {
+		t.Fatalf("GetByIP(oldIP) after reassignment: got err=%v, want ErrNoLease", err)
+	}
+	l, err := s.GetByIP(newIP)
+	if err != nil {
+		t.Fatalf("GetByIP(newIP): %v", err)
+	}
+	if l.MAC.String() != mac.String() {
+		t.Fatalf("GetByIP(newIP) returned lease for %s, want %s", l.MAC, mac)
+	}
+}
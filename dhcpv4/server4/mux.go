@@ -0,0 +1,122 @@
+package server4
+
+import (
+	"net"
+	"sync"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+// Middleware wraps a Handler to produce another Handler, e.g. for logging,
+// metrics, or rate-limiting. Middlewares are applied in the order they were
+// registered with ServeMux.Use, so the first one registered is the outermost.
+type Middleware func(Handler) Handler
+
+// ServeMux is a DHCPv4 message router, in the style of net/http.ServeMux. It
+// dispatches incoming messages to a registered Handler based on their
+// dhcpv4.MessageType, and implements the Handler interface itself so it can
+// be passed directly to NewServer.
+type ServeMux struct {
+	mu          sync.RWMutex
+	handlers    map[dhcpv4.MessageType]Handler
+	defaultFunc Handler
+	middlewares []Middleware
+}
+
+// NewServeMux creates an empty ServeMux ready for handler registration.
+func NewServeMux() *ServeMux {
+	return &ServeMux{
+		handlers: make(map[dhcpv4.MessageType]Handler),
+	}
+}
+
+// DefaultServeMux is a ready-made package-level ServeMux, analogous to
+// http.DefaultServeMux. Handlers are registered on it through its own
+// methods; the package has no top-level Handle* functions.
+var DefaultServeMux = NewServeMux()
+
+// Use appends a middleware to the chain applied to every message dispatched
+// through the mux, including the default handler. Middlewares run in
+// registration order, with the first one registered being the outermost.
+func (mux *ServeMux) Use(mw Middleware) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	mux.middlewares = append(mux.middlewares, mw)
+}
+
+// Handle registers handler for the given DHCPv4 message type, replacing any
+// previously registered handler for that type.
+func (mux *ServeMux) Handle(msgType dhcpv4.MessageType, handler HandlerFunc) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	mux.handlers[msgType] = handler
+}
+
+// HandleDefault registers a fallback handler invoked for message types with
+// no specific handler registered. If unset, unmatched messages are dropped.
+func (mux *ServeMux) HandleDefault(handler HandlerFunc) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	mux.defaultFunc = handler
+}
+
+// HandleDiscover registers handler for DHCPDISCOVER messages.
+func (mux *ServeMux) HandleDiscover(handler HandlerFunc) {
+	mux.Handle(dhcpv4.MessageTypeDiscover, handler)
+}
+
+// HandleOffer registers handler for DHCPOFFER messages.
+func (mux *ServeMux) HandleOffer(handler HandlerFunc) {
+	mux.Handle(dhcpv4.MessageTypeOffer, handler)
+}
+
+// HandleRequest registers handler for DHCPREQUEST messages.
+func (mux *ServeMux) HandleRequest(handler HandlerFunc) {
+	mux.Handle(dhcpv4.MessageTypeRequest, handler)
+}
+
+// HandleDecline registers handler for DHCPDECLINE messages.
+func (mux *ServeMux) HandleDecline(handler HandlerFunc) {
+	mux.Handle(dhcpv4.MessageTypeDecline, handler)
+}
+
+// HandleAck registers handler for DHCPACK messages.
+func (mux *ServeMux) HandleAck(handler HandlerFunc) {
+	mux.Handle(dhcpv4.MessageTypeAck, handler)
+}
+
+// HandleNak registers handler for DHCPNAK messages.
+func (mux *ServeMux) HandleNak(handler HandlerFunc) {
+	mux.Handle(dhcpv4.MessageTypeNak, handler)
+}
+
+// HandleRelease registers handler for DHCPRELEASE messages.
+func (mux *ServeMux) HandleRelease(handler HandlerFunc) {
+	mux.Handle(dhcpv4.MessageTypeRelease, handler)
+}
+
+// HandleInform registers handler for DHCPINFORM messages.
+func (mux *ServeMux) HandleInform(handler HandlerFunc) {
+	mux.Handle(dhcpv4.MessageTypeInform, handler)
+}
+
+// ServeDHCP implements Handler. It looks up the handler registered for
+// m.MessageType(), falling back to the default handler if set, wraps it with
+// every registered middleware, and invokes it.
+func (mux *ServeMux) ServeDHCP(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4) {
+	mux.mu.RLock()
+	handler, ok := mux.handlers[m.MessageType()]
+	if !ok {
+		handler = mux.defaultFunc
+	}
+	middlewares := mux.middlewares
+	mux.mu.RUnlock()
+
+	if handler == nil {
+		return
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	handler.ServeDHCP(conn, peer, m)
+}
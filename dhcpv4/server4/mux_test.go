@@ -0,0 +1,87 @@
+package server4
+
+import (
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+func mustMessage(t *testing.T, msgType dhcpv4.MessageType) *dhcpv4.DHCPv4 {
+	t.Helper()
+	m, err := dhcpv4.New(dhcpv4.WithMessageType(msgType))
+	if err != nil {
+		t.Fatalf("dhcpv4.New: %v", err)
+	}
+	return m
+}
+
+func TestServeMuxDispatchesByMessageType(t *testing.T) {
+	mux := NewServeMux()
+	var gotDiscover, gotRequest bool
+	mux.HandleDiscover(func(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4) { gotDiscover = true })
+	mux.HandleRequest(func(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4) { gotRequest = true })
+
+	mux.ServeDHCP(nil, nil, mustMessage(t, dhcpv4.MessageTypeDiscover))
+	if !gotDiscover || gotRequest {
+		t.Fatalf("after DISCOVER: gotDiscover=%v gotRequest=%v, want true/false", gotDiscover, gotRequest)
+	}
+
+	gotDiscover = false
+	mux.ServeDHCP(nil, nil, mustMessage(t, dhcpv4.MessageTypeRequest))
+	if gotDiscover || !gotRequest {
+		t.Fatalf("after REQUEST: gotDiscover=%v gotRequest=%v, want false/true", gotDiscover, gotRequest)
+	}
+}
+
+func TestServeMuxFallsBackToDefaultHandler(t *testing.T) {
+	mux := NewServeMux()
+	var gotDefault bool
+	mux.HandleDefault(func(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4) { gotDefault = true })
+
+	mux.ServeDHCP(nil, nil, mustMessage(t, dhcpv4.MessageTypeAck))
+	if !gotDefault {
+		t.Fatal("unregistered message type did not reach the default handler")
+	}
+}
+
+func TestServeMuxDropsUnmatchedWithoutDefault(t *testing.T) {
+	mux := NewServeMux()
+	called := false
+	mux.HandleDiscover(func(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4) { called = true })
+
+	// Should not panic, and should not reach the handler registered for a
+	// different message type.
+	mux.ServeDHCP(nil, nil, mustMessage(t, dhcpv4.MessageTypeAck))
+	if called {
+		t.Fatal("ServeDHCP invoked a handler registered for a different message type")
+	}
+}
+
+func TestServeMuxMiddlewareOrdering(t *testing.T) {
+	mux := NewServeMux()
+	var order []string
+	record := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4) {
+				order = append(order, name)
+				next.ServeDHCP(conn, peer, m)
+			})
+		}
+	}
+	mux.Use(record("first"))
+	mux.Use(record("second"))
+	mux.HandleDiscover(func(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4) { order = append(order, "handler") })
+
+	mux.ServeDHCP(nil, nil, mustMessage(t, dhcpv4.MessageTypeDiscover))
+
+	want := []string{"first", "second", "handler"}
+	if len(order) != len(want) {
+		t.Fatalf("got order %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("got order %v, want %v", order, want)
+		}
+	}
+}
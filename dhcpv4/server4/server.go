@@ -1,23 +1,28 @@
 package server4
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/insomniacslk/dhcp/dhcpv4"
 )
 
 /*
   To use the DHCPv4 server code you have to call NewServer with two arguments:
-  - a handler function, that will be called every time a valid DHCPv4 packet is
+  - a handler, that will be called every time a valid DHCPv4 packet is
     received, and
   - an address to listen on.
 
-  The handler is a function that takes as input a packet connection, that can be
-  used to reply to the client; a peer address, that identifies the client sending
-  the request, and the DHCPv4 packet itself. Just implement your custom logic in
-  the handler.
+  The handler is anything implementing the Handler interface, which receives
+  a packet connection that can be used to reply to the client; a peer
+  address, that identifies the client sending the request, and the DHCPv4
+  packet itself. Just implement your custom logic in the handler. A plain
+  function can be turned into a Handler with HandlerFunc, and ServeMux (see
+  mux.go) can be used to dispatch on the DHCPv4 message type.
 
   The address to listen on is used to know IP address, port and optionally the
   scope to create and UDP socket to listen on for DHCPv4 traffic.
@@ -32,6 +37,7 @@ import (
 	"net"
 
 	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv4/server4"
 )
 
 func handler(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4) {
@@ -44,64 +50,182 @@ func main() {
 		IP:   net.ParseIP("127.0.0.1"),
 		Port: 67,
 	}
-	server, err := dhcpv4.NewServer(laddr, handler)
+	server, err := server4.NewServer(&laddr, server4.HandlerFunc(handler))
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// This never returns. If you want to do other stuff, dump it into a
-	// goroutine.
-	server.Serve()
+	// This never returns until the server is shut down. If you want to do
+	// other stuff, dump it into a goroutine.
+	if err := server.Serve(); err != nil && err != server4.ErrServerClosed {
+		log.Fatal(err)
+	}
 }
 
 */
 
 // Handler is a type that defines the handler function to be called every time a
-// valid DHCPv4 message is received
-type Handler func(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4)
+// valid DHCPv4 message is received.
+type Handler interface {
+	ServeDHCP(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4)
+}
+
+// HandlerFunc is an adapter to allow the use of ordinary functions as
+// Handlers, in the style of net/http.HandlerFunc.
+type HandlerFunc func(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4)
+
+// ServeDHCP calls f(conn, peer, m).
+func (f HandlerFunc) ServeDHCP(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4) {
+	f(conn, peer, m)
+}
+
+// ErrServerClosed is returned by Serve after Shutdown has been called, in
+// the style of net/http.ErrServerClosed.
+var ErrServerClosed = errors.New("server4: Server closed")
+
+// readPulse bounds how long a single ReadFrom blocks, by pulsing
+// SetReadDeadline, so that Serve notices a Shutdown call promptly instead of
+// being stuck inside a read with no pending traffic.
+const readPulse = 500 * time.Millisecond
+
+// DefaultReadBufferSize is the per-packet read buffer size used when
+// WithReadBufferSize is not given, large enough for the default Ethernet
+// MTU.
+const DefaultReadBufferSize = 1500
+
+// clientPort and serverPort are the well-known DHCPv4 UDP ports, shared by
+// every listener mode (UDP, raw-socket, IP_PKTINFO) and by the conflict
+// probe in conflict.go. They live here rather than in a unix-only conn_*.go
+// file so the package still builds on every target.
+const (
+	clientPort = 68
+	serverPort = 67
+)
 
 // Server represents a DHCPv4 server object
 type Server struct {
-	conn       net.PacketConn
-	connMutex  sync.Mutex
-	shouldStop chan bool
-	Handler    Handler
+	conn           net.PacketConn
+	connMutex      sync.Mutex
+	shouldStop     chan struct{}
+	stopOnce       sync.Once
+	wg             sync.WaitGroup
+	readBufferSize int
+	bufPool        sync.Pool
+	Handler        Handler
 }
 
-// Serve serves requests.
-func (s *Server) Serve() {
+// Serve serves requests, blocking until either the connection is closed, a
+// read fails, or Shutdown is called, in which case it returns
+// ErrServerClosed.
+func (s *Server) Serve() error {
 	log.Printf("Server listening on %s", s.conn.LocalAddr())
 	log.Print("Ready to handle requests")
 	for {
-		rbuf := make([]byte, 4096) // FIXME this is bad
-		n, peer, err := s.conn.ReadFrom(rbuf)
+		select {
+		case <-s.shouldStop:
+			return ErrServerClosed
+		default:
+		}
+
+		if err := s.conn.SetReadDeadline(time.Now().Add(readPulse)); err != nil {
+			log.Printf("Error setting read deadline: %v", err)
+		}
+
+		rbuf := s.bufPool.Get().([]byte)
+		conn := s.conn
+		var (
+			n    int
+			peer net.Addr
+			err  error
+		)
+		if ifConn, ok := s.conn.(ifAwarePacketConn); ok {
+			var ifi *net.Interface
+			var dst net.IP
+			n, peer, ifi, dst, err = ifConn.ReadFromIf(rbuf)
+			if err == nil {
+				conn = &ServeContext{PacketConn: s.conn, Ifindex: ifIndex(ifi), Ifname: ifName(ifi), DestinationIP: dst}
+			}
+		} else {
+			n, peer, err = s.conn.ReadFrom(rbuf)
+		}
 		if err != nil {
+			s.bufPool.Put(rbuf)
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			select {
+			case <-s.shouldStop:
+				return ErrServerClosed
+			default:
+			}
 			log.Printf("Error reading from packet conn: %v", err)
-			return
+			return err
 		}
 		log.Printf("Handling request from %v", peer)
 
 		m, err := dhcpv4.FromBytes(rbuf[:n])
 		if err != nil {
+			s.bufPool.Put(rbuf)
 			log.Printf("Error parsing DHCPv4 request: %v", err)
 			continue
 		}
-		go s.Handler(s.conn, peer, m)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.bufPool.Put(rbuf)
+			s.Handler.ServeDHCP(conn, peer, m)
+		}()
 	}
 }
 
-// Close sends a termination request to the server, and closes the UDP listener
+// Close sends a termination request to the server, and closes the UDP
+// listener immediately, without waiting for in-flight handlers to finish.
+// Use Shutdown for a graceful stop.
 func (s *Server) Close() error {
+	s.stopOnce.Do(func() { close(s.shouldStop) })
 	return s.conn.Close()
 }
 
+// Shutdown gracefully stops the server: it stops Serve from accepting new
+// packets, waits for already-running Handler invocations to return (or for
+// ctx to expire, whichever comes first), and then closes the listener. It is
+// safe to call Shutdown even if Serve has already returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.shouldStop) })
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return s.conn.Close()
+	case <-ctx.Done():
+		s.conn.Close()
+		return ctx.Err()
+	}
+}
+
 // ServerOpt adds optional configuration to a server.
-type ServerOpt func(s *Server)
+type ServerOpt func(s *Server) error
 
 // WithConn configures the server with the given connection.
 func WithConn(c net.PacketConn) ServerOpt {
-	return func(s *Server) {
+	return func(s *Server) error {
 		s.conn = c
+		return nil
+	}
+}
+
+// WithReadBufferSize sets the size of the per-packet read buffer, in bytes.
+// It should be at least the MTU of the listening interface; the default,
+// DefaultReadBufferSize, is sized for a standard Ethernet MTU.
+func WithReadBufferSize(n int) ServerOpt {
+	return func(s *Server) error {
+		s.readBufferSize = n
+		return nil
 	}
 }
 
@@ -109,11 +233,19 @@ func WithConn(c net.PacketConn) ServerOpt {
 func NewServer(addr *net.UDPAddr, handler Handler, opt ...ServerOpt) (*Server, error) {
 	s := &Server{
 		Handler:    handler,
-		shouldStop: make(chan bool, 1),
+		shouldStop: make(chan struct{}),
 	}
 
 	for _, o := range opt {
-		o(s)
+		if err := o(s); err != nil {
+			return nil, err
+		}
+	}
+	if s.readBufferSize <= 0 {
+		s.readBufferSize = DefaultReadBufferSize
+	}
+	s.bufPool.New = func() interface{} {
+		return make([]byte, s.readBufferSize)
 	}
 	if s.conn == nil {
 		var err error